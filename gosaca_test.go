@@ -1,55 +1,103 @@
 package gosaca_bigtests
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/jgallagher/gosaca"
+	"index/suffixarray"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 var fileCache = map[string][]byte {}
 
-func checkCorrectSuffixArrayBwt(input []byte, SA []int) error {
+// readCorpusFile reads filename once for a test check.
+func readCorpusFile(t *testing.T, filename string) []byte {
+	fh, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	b, err := ioutil.ReadAll(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// cachedCorpusFile reads filename once and reuses the bytes across the
+// repeated b.N iterations a benchmark runs through.
+func cachedCorpusFile(filename string) []byte {
+	if b := fileCache[filename]; b != nil {
+		return b
+	}
+	fh, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	b, err := ioutil.ReadAll(fh)
+	fh.Close()
+	if err != nil {
+		panic(err)
+	}
+	fileCache[filename] = b
+	return b
+}
+
+// checkCorrectSuffixArrayBwt is generic over the SA element width so the same
+// check covers both the default int-sized SA and the int32 SA produced by
+// ComputeSuffixArray32/ComputeSuffixArrayMmap.
+func checkCorrectSuffixArrayBwt[S int | int32](ws *gosaca.WorkSpace, input []byte, SA []S) error {
 	n := len(input)
 
 	fmt.Printf("%s: starting sanity check of SA values\n", time.Now())
 	// first make sure every element in SA is unique and valid
 	indicesSeen := make([]bool, n)
+	intSA := make([]int, n)
 	for i, s := range SA {
-		if s < 0 || s >= n {
-			return fmt.Errorf("Invalid SA entry: SA[%d] = %d\n", i, s)
+		si := int(s)
+		if si < 0 || si >= n {
+			return fmt.Errorf("Invalid SA entry: SA[%d] = %d\n", i, si)
 		}
-		if indicesSeen[s] == true {
-			return fmt.Errorf("Duplicate SA entry: SA[%d] = %d was seen before\n", i, s)
+		if indicesSeen[si] == true {
+			return fmt.Errorf("Duplicate SA entry: SA[%d] = %d was seen before\n", i, si)
 		}
-		indicesSeen[s] = true
+		indicesSeen[si] = true
+		intSA[i] = si
 	}
 
 	// Doing a naive check (like the gosaca package does) is way too expensive
 	// for these large tests. Instead, we'll compute the Inverse Burrows-Wheel
-	// Transform and make sure it matches the original input. The algorithm we
-	// follow here is from section 4.2 the original paper (currently available
-	// at http://www.hpl.hp.com/techreports/Compaq-DEC/SRC-RR-124.pdf), with
+	// Transform ourselves, directly from the SA we were handed, and make sure
+	// it matches the original input. This has to stay independent of
+	// gosaca's own BWT/IBWT: the large-corpus files never get the stdlib
+	// cross-check (checkAgainstStdlib is too slow to run on them), so this is
+	// their only oracle, and it needs to catch a bad SA even if ComputeBWT
+	// and InverseBWT share a compensating bug. The algorithm we follow here
+	// is from section 4.2 the original paper (currently available at
+	// http://www.hpl.hp.com/techreports/Compaq-DEC/SRC-RR-124.pdf), with
 	// the added wrinkle that we need to account for a sentinel character at
 	// the end of our string. To deal with this (simply), we make the alphabet
 	// size 257 and use -1 as the sentinel for the purposes of the Inv BWT.
 	fmt.Printf("%s: starting inverse BWT check\n", time.Now())
 	bwtPos := 0
 	L := make([]int, n+1)
-	//ibwt := make([]int, n+1)
 	C := make(map[int]int) // storage for 257 alphabet chars (-1=sentinel, 0-256=data)
 	P := make([]int, n+1)
 	// construct bwt from SA
 	L[0] = int(input[n-1])
 	for i := 0; i < n; i++ {
-		if SA[i] == 0 {
+		if intSA[i] == 0 {
 			bwtPos = i + 1
 			L[i+1] = -1
 		} else {
-			L[i+1] = int(input[SA[i]-1])
+			L[i+1] = int(input[intSA[i]-1])
 		}
 	}
 	for i := 0; i < n+1; i++ {
@@ -73,27 +121,110 @@ func checkCorrectSuffixArrayBwt(input []byte, SA []int) error {
 			return fmt.Errorf("Inverse BWT did not produce original string: position %d: IBWT=%d, input=%d", i, L[bwtPos], input[i])
 		}
 	}
+
+	// Also exercise gosaca's own public BWT/IBWT round-trip, so this check
+	// stays a real user of that API rather than just the independent
+	// reimplementation above.
+	fmt.Printf("%s: starting public BWT/IBWT round-trip check\n", time.Now())
+	bwt, primaryIndex, err := ws.ComputeBWT(input, intSA)
+	if err != nil {
+		return fmt.Errorf("ComputeBWT failed: %s", err)
+	}
+	if !bytes.Equal(ws.InverseBWT(bwt, primaryIndex), input) {
+		return fmt.Errorf("Inverse BWT did not reproduce original input")
+	}
 	return nil
 }
 
-func checkSaOfFile(t *testing.T, ws *gosaca.WorkSpace, filename string) {
-	fh, err := os.Open(filename)
-	if err != nil {
-		t.Fatal(err)
+func checkSaOfFile(t *testing.T, ws *gosaca.WorkSpace, filename string) ([]byte, []int) {
+	b := readCorpusFile(t, filename)
+
+	SA := make([]int, len(b))
+	fmt.Printf("%s: starting SA on %s\n", time.Now(), filename)
+	ws.ComputeSuffixArray(b, SA)
+	if err := checkCorrectSuffixArrayBwt(ws, b, SA); err != nil {
+		t.Fatalf("bwt check failure on file %s: %s", filename, err)
 	}
-	defer fh.Close()
+	return b, SA
+}
 
-	b, err := ioutil.ReadAll(fh)
-	if err != nil {
-		t.Fatal(err)
+// stdlibSuffixArray builds the suffix array for input using the standard
+// library's index/suffixarray and extracts its internal array, giving a
+// completely independent oracle to cross-check gosaca against. The array is
+// unexported, so we reach in with reflection rather than trust sort-order
+// comparisons (which can hide tie-breaking bugs at the sentinel).
+func stdlibSuffixArray(t *testing.T, input []byte) []int {
+	idx := suffixarray.New(input)
+	sa := reflect.ValueOf(idx).Elem().FieldByName("sa")
+	sa32 := sa.FieldByName("int32")
+	sa32 = reflect.NewAt(sa32.Type(), unsafe.Pointer(sa32.UnsafeAddr())).Elem()
+	int32s, ok := sa32.Interface().([]int32)
+	if !ok || int32s == nil {
+		t.Fatalf("could not extract index/suffixarray's internal SA via reflection; stdlib internals may have changed")
+	}
+
+	out := make([]int, len(int32s))
+	for i, v := range int32s {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// checkAgainstStdlib cross-validates gosaca's SA against the one built by
+// index/suffixarray.New, which uses an entirely different construction
+// algorithm. This catches classes of bugs, such as tie-breaking at the
+// sentinel, that the inverse-BWT round-trip cannot detect.
+func checkAgainstStdlib(t *testing.T, filename string, input []byte, SA []int) {
+	want := stdlibSuffixArray(t, input)
+	if len(want) != len(SA) {
+		t.Fatalf("stdlib cross-check: SA length mismatch for %s: gosaca=%d stdlib=%d", filename, len(SA), len(want))
+	}
+	for i := range SA {
+		if SA[i] != want[i] {
+			t.Fatalf("stdlib cross-check: SA mismatch for %s at index %d: gosaca=%d stdlib=%d", filename, i, SA[i], want[i])
+		}
+	}
+}
+
+// commonPrefixLen returns the length of the longest common prefix of a and b.
+func commonPrefixLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// checkLCP verifies a sampled subset of LCP against a direct byte comparison
+// of the corresponding adjacent suffixes in SA order. Checking every rank is
+// far too expensive for these corpora, but a strided sample is enough to
+// catch an off-by-one in the Kasai walk or a bad "h" reset.
+const lcpSampleStride = 997
+
+func checkLCP(t *testing.T, filename string, input []byte, SA []int, LCP []int) {
+	n := len(input)
+	for i := 1; i < n; i += lcpSampleStride {
+		want := commonPrefixLen(input[SA[i-1]:], input[SA[i]:])
+		if LCP[i] != want {
+			t.Fatalf("LCP mismatch for file %s at rank %d: got %d, want %d", filename, i, LCP[i], want)
+		}
 	}
+}
+
+func checkSaAndLcpOfFile(t *testing.T, ws *gosaca.WorkSpace, filename string) {
+	b := readCorpusFile(t, filename)
 
 	SA := make([]int, len(b))
 	fmt.Printf("%s: starting SA on %s\n", time.Now(), filename)
 	ws.ComputeSuffixArray(b, SA)
-	if err := checkCorrectSuffixArrayBwt(b, SA); err != nil {
+	if err := checkCorrectSuffixArrayBwt(ws, b, SA); err != nil {
 		t.Fatalf("bwt check failure on file %s: %s", filename, err)
 	}
+
+	LCP := make([]int, len(b))
+	fmt.Printf("%s: starting LCP on %s\n", time.Now(), filename)
+	ws.ComputeLCP(b, SA, LCP)
+	checkLCP(t, filename, b, SA, LCP)
 }
 
 func TestLargeFiles(t *testing.T) {
@@ -110,10 +241,22 @@ func TestLargeFiles(t *testing.T) {
 		path.Join("large_corpus", "sprot34.dat"),
 		path.Join("large_corpus", "w3c2"),
 	} {
-		checkSaOfFile(t, ws, filename)
+		checkSaAndLcpOfFile(t, ws, filename)
 	}
 }
 
+// stdlibCrossCheckFiles are the gauntlet files small and well-behaved enough
+// to also build with index/suffixarray; the Fibonacci and fss inputs are
+// exactly the pathological, highly-repetitive strings known to break SA-IS
+// variants, which is why they're worth a second, independently-built oracle.
+var stdlibCrossCheckFiles = map[string]bool{
+	path.Join("gauntlet_corpus", "abac"):          true,
+	path.Join("gauntlet_corpus", "abba"):          true,
+	path.Join("gauntlet_corpus", "fib_s14930352"): true,
+	path.Join("gauntlet_corpus", "fss9"):          true,
+	path.Join("gauntlet_corpus", "fss10"):         true,
+}
+
 func TestGauntletFiles(t *testing.T) {
 	ws := &gosaca.WorkSpace{}
 	for _, filename := range []string{
@@ -129,26 +272,92 @@ func TestGauntletFiles(t *testing.T) {
 		path.Join("gauntlet_corpus", "test2"),
 		path.Join("gauntlet_corpus", "test3"),
 	} {
-		checkSaOfFile(t, ws, filename)
+		b, SA := checkSaOfFile(t, ws, filename)
+		if stdlibCrossCheckFiles[filename] {
+			checkAgainstStdlib(t, filename, b, SA)
+		}
+	}
+}
+
+// checkSaEqual asserts that the int32 (or mmap) SA got matches, element for
+// element, the int-sized SA want produced by ComputeSuffixArray. The inverse
+// BWT check in checkCorrectSuffixArrayBwt validates got on its own; this
+// direct comparison additionally requires the int32 path to produce exactly
+// the same SA as the int path, so a width-specific difference (e.g. a bad
+// int32 truncation) shows up as a mismatch at a specific index.
+func checkSaEqual[S int | int32](t *testing.T, filename, label string, want []int, got []S) {
+	if len(want) != len(got) {
+		t.Fatalf("%s SA length mismatch for %s: got=%d want=%d", label, filename, len(got), len(want))
+	}
+	for i := range want {
+		if int(got[i]) != want[i] {
+			t.Fatalf("%s SA mismatch for %s at index %d: got=%d want=%d", label, filename, i, got[i], want[i])
+		}
+	}
+}
+
+func checkSaOfFile32(t *testing.T, ws *gosaca.WorkSpace, filename string) {
+	b := readCorpusFile(t, filename)
+
+	refSA := make([]int, len(b))
+	ws.ComputeSuffixArray(b, refSA)
+
+	SA := make([]int32, len(b))
+	fmt.Printf("%s: starting 32-bit SA on %s\n", time.Now(), filename)
+	ws.ComputeSuffixArray32(b, SA)
+	if err := checkCorrectSuffixArrayBwt(ws, b, SA); err != nil {
+		t.Fatalf("32-bit SA bwt check failure on file %s: %s", filename, err)
+	}
+	checkSaEqual(t, filename, "32-bit", refSA, SA)
+}
+
+func checkSaOfFileMmap(t *testing.T, ws *gosaca.WorkSpace, filename string) {
+	b := readCorpusFile(t, filename)
+
+	refSA := make([]int, len(b))
+	ws.ComputeSuffixArray(b, refSA)
+
+	SA := make([]int32, len(b))
+	fmt.Printf("%s: starting mmap SA on %s\n", time.Now(), filename)
+	if err := ws.ComputeSuffixArrayMmap(filename, SA); err != nil {
+		t.Fatalf("mmap SA failed on file %s: %s", filename, err)
+	}
+	if err := checkCorrectSuffixArrayBwt(ws, b, SA); err != nil {
+		t.Fatalf("mmap SA bwt check failure on file %s: %s", filename, err)
+	}
+	checkSaEqual(t, filename, "mmap", refSA, SA)
+}
+
+// TestGauntletFiles32 exercises the int32-SA and mmap-backed input paths
+// against the gauntlet corpus. These files are small, so the point isn't
+// memory savings here, it's correctness: every input in this corpus is well
+// under the 2^31 element limit, so checkSaOfFile32/checkSaOfFileMmap compare
+// both paths element-wise against the int-SA result from ComputeSuffixArray,
+// on top of the BWT round-trip check they share with TestGauntletFiles.
+func TestGauntletFiles32(t *testing.T) {
+	ws := &gosaca.WorkSpace{}
+	for _, filename := range []string{
+		path.Join("gauntlet_corpus", "abac"),
+		path.Join("gauntlet_corpus", "abba"),
+		path.Join("gauntlet_corpus", "book1x20"),
+		path.Join("gauntlet_corpus", "fib_s14930352"),
+		path.Join("gauntlet_corpus", "fss10"),
+		path.Join("gauntlet_corpus", "fss9"),
+		path.Join("gauntlet_corpus", "houston"),
+		path.Join("gauntlet_corpus", "paper5x80"),
+		path.Join("gauntlet_corpus", "test1"),
+		path.Join("gauntlet_corpus", "test2"),
+		path.Join("gauntlet_corpus", "test3"),
+	} {
+		checkSaOfFile32(t, ws, filename)
+		checkSaOfFileMmap(t, ws, filename)
 	}
 }
 
 func runBenchmark(b *testing.B, filename string) {
 	b.StopTimer()
 	ws := &gosaca.WorkSpace{}
-	input := fileCache[filename]
-	if input == nil {
-		fh, err := os.Open(filename)
-		if err != nil {
-			panic(err)
-		}
-		input, err = ioutil.ReadAll(fh)
-		fh.Close()
-		if err != nil {
-			panic(err)
-		}
-		fileCache[filename] = input
-	}
+	input := cachedCorpusFile(filename)
 	SA := make([]int, len(input))
 	b.StartTimer()
 
@@ -157,6 +366,32 @@ func runBenchmark(b *testing.B, filename string) {
 	}
 }
 
+func runBenchmarkLCP(b *testing.B, filename string) {
+	b.StopTimer()
+	ws := &gosaca.WorkSpace{}
+	input := cachedCorpusFile(filename)
+	SA := make([]int, len(input))
+	ws.ComputeSuffixArray(input, SA)
+	LCP := make([]int, len(input))
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		ws.ComputeLCP(input, SA, LCP)
+	}
+}
+
+func runBenchmark32(b *testing.B, filename string) {
+	b.StopTimer()
+	ws := &gosaca.WorkSpace{}
+	input := cachedCorpusFile(filename)
+	SA := make([]int32, len(input))
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		ws.ComputeSuffixArray32(input, SA)
+	}
+}
+
 func Benchmark_chr22dna(b *testing.B) { runBenchmark(b, path.Join("large_corpus", "chr22.dna")) }
 func Benchmark_etext99(b *testing.B)  { runBenchmark(b, path.Join("large_corpus", "etext99")) }
 func Benchmark_gcc30tar(b *testing.B) { runBenchmark(b, path.Join("large_corpus", "gcc-3.0.tar")) }
@@ -182,3 +417,75 @@ func Benchmark_paper5x80(b *testing.B) { runBenchmark(b, path.Join("gauntlet_cor
 func Benchmark_test1(b *testing.B)     { runBenchmark(b, path.Join("gauntlet_corpus", "test1")) }
 func Benchmark_test2(b *testing.B)     { runBenchmark(b, path.Join("gauntlet_corpus", "test2")) }
 func Benchmark_test3(b *testing.B)     { runBenchmark(b, path.Join("gauntlet_corpus", "test3")) }
+
+func Benchmark_chr22dna_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("large_corpus", "chr22.dna")) }
+func Benchmark_etext99_LCP(b *testing.B)  { runBenchmarkLCP(b, path.Join("large_corpus", "etext99")) }
+func Benchmark_gcc30tar_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("large_corpus", "gcc-3.0.tar"))
+}
+func Benchmark_howto_LCP(b *testing.B)  { runBenchmarkLCP(b, path.Join("large_corpus", "howto")) }
+func Benchmark_jdk13c_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("large_corpus", "jdk13c")) }
+func Benchmark_linux245tar_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("large_corpus", "linux-2.4.5.tar"))
+}
+func Benchmark_rctail96_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("large_corpus", "rctail96")) }
+func Benchmark_rfc_LCP(b *testing.B)      { runBenchmarkLCP(b, path.Join("large_corpus", "rfc")) }
+func Benchmark_sprot34dat_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("large_corpus", "sprot34.dat"))
+}
+func Benchmark_w3c2_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("large_corpus", "w3c2")) }
+func Benchmark_abac_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "abac")) }
+func Benchmark_abba_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "abba")) }
+func Benchmark_book1x20_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("gauntlet_corpus", "book1x20"))
+}
+func Benchmark_fib_s14930352_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("gauntlet_corpus", "fib_s14930352"))
+}
+func Benchmark_fss10_LCP(b *testing.B)   { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "fss10")) }
+func Benchmark_fss9_LCP(b *testing.B)    { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "fss9")) }
+func Benchmark_houston_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "houston")) }
+func Benchmark_paper5x80_LCP(b *testing.B) {
+	runBenchmarkLCP(b, path.Join("gauntlet_corpus", "paper5x80"))
+}
+func Benchmark_test1_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "test1")) }
+func Benchmark_test2_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "test2")) }
+func Benchmark_test3_LCP(b *testing.B) { runBenchmarkLCP(b, path.Join("gauntlet_corpus", "test3")) }
+
+func Benchmark_chr22dna_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("large_corpus", "chr22.dna"))
+}
+func Benchmark_etext99_int32(b *testing.B) { runBenchmark32(b, path.Join("large_corpus", "etext99")) }
+func Benchmark_gcc30tar_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("large_corpus", "gcc-3.0.tar"))
+}
+func Benchmark_howto_int32(b *testing.B)  { runBenchmark32(b, path.Join("large_corpus", "howto")) }
+func Benchmark_jdk13c_int32(b *testing.B) { runBenchmark32(b, path.Join("large_corpus", "jdk13c")) }
+func Benchmark_linux245tar_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("large_corpus", "linux-2.4.5.tar"))
+}
+func Benchmark_rctail96_int32(b *testing.B) { runBenchmark32(b, path.Join("large_corpus", "rctail96")) }
+func Benchmark_rfc_int32(b *testing.B)      { runBenchmark32(b, path.Join("large_corpus", "rfc")) }
+func Benchmark_sprot34dat_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("large_corpus", "sprot34.dat"))
+}
+func Benchmark_w3c2_int32(b *testing.B) { runBenchmark32(b, path.Join("large_corpus", "w3c2")) }
+func Benchmark_abac_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "abac")) }
+func Benchmark_abba_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "abba")) }
+func Benchmark_book1x20_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("gauntlet_corpus", "book1x20"))
+}
+func Benchmark_fib_s14930352_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("gauntlet_corpus", "fib_s14930352"))
+}
+func Benchmark_fss10_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "fss10")) }
+func Benchmark_fss9_int32(b *testing.B)  { runBenchmark32(b, path.Join("gauntlet_corpus", "fss9")) }
+func Benchmark_houston_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("gauntlet_corpus", "houston"))
+}
+func Benchmark_paper5x80_int32(b *testing.B) {
+	runBenchmark32(b, path.Join("gauntlet_corpus", "paper5x80"))
+}
+func Benchmark_test1_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "test1")) }
+func Benchmark_test2_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "test2")) }
+func Benchmark_test3_int32(b *testing.B) { runBenchmark32(b, path.Join("gauntlet_corpus", "test3")) }